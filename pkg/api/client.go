@@ -1,18 +1,57 @@
 package api
 
 import (
+	"context"
+	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
+	"log"
 	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/hashicorp/go-retryablehttp"
 	"github.com/profclems/glab/internal/config"
 	"github.com/profclems/glab/internal/glinstance"
 	"github.com/xanzy/go-gitlab"
+	"golang.org/x/oauth2"
+)
+
+// apiDebugEnvVar, when set to "api", makes the debug transport middleware
+// dump full request/response bodies to stderr. Handy when a glab command
+// fails against a custom GitLab install and the failure isn't obvious from
+// the returned error alone.
+const apiDebugEnvVar = "GLAB_DEBUG"
+
+// oauthRefreshSkew is how far ahead of a token's expiry we proactively
+// refresh it, so a request doesn't race a token that's about to die.
+const oauthRefreshSkew = 2 * time.Minute
+
+// unixSocketPrefix marks a host passed to NewClient/NewClientWithCfg as a
+// path to a Unix domain socket rather than a TCP host, mirroring gitlab-shell's
+// "http+unix://" scheme.
+const unixSocketPrefix = "unix:"
+
+// unixSocketBaseURL is the fixed base every request is addressed to when
+// talking over a Unix domain socket; the transport's DialContext redirects
+// the actual connection to the socket regardless of what's in the URL.
+const unixSocketBaseURL = "http://unix"
+
+// Default retry behaviour applied to every request made through a Client,
+// overridable via WithHTTPRetryOpts or the retry_max / retry_wait_min /
+// retry_wait_max config keys.
+const (
+	defaultRetryMax     = 3
+	defaultRetryWaitMin = 1 * time.Second
+	defaultRetryWaitMax = 30 * time.Second
 )
 
 // AuthType represents an authentication type within GitLab.
@@ -45,6 +84,24 @@ type Client struct {
 	AuthType authType
 	// custom certificate
 	caFile string
+	// client certificate / key pair used for mutual TLS
+	certFile string
+	keyFile  string
+	// path to a Unix domain socket to dial instead of a TCP host, set when
+	// the host carries the "unix:" prefix or a socket_path config key is set
+	socketPath string
+	// OAuth2 state, used when AuthType is OAuthToken. See NewClientWithOAuth.
+	oauthToken   string
+	refreshToken string
+	tokenExpiry  time.Time
+	// additional transport middleware layered on top of the built-in
+	// correlation-ID/logging/debug-dump ones. See WithTransportMiddleware.
+	transportMiddleware []func(http.RoundTripper) http.RoundTripper
+	// retry behaviour for transient failures. See WithHTTPRetryOpts.
+	retryWaitMin   time.Duration
+	retryWaitMax   time.Duration
+	retryMax       int
+	retryAllowPost bool
 	// Protocol: host url protocol to make requests. Default is https
 	Protocol string
 
@@ -68,6 +125,9 @@ func RefreshClient()  {
 		AuthType:           NoToken,
 		httpClient:         &http.Client{},
 		refreshLabInstance: true,
+		retryWaitMin:       defaultRetryWaitMin,
+		retryWaitMax:       defaultRetryWaitMax,
+		retryMax:           defaultRetryMax,
 	}
 }
 
@@ -76,6 +136,22 @@ func GetClient() *Client {
 	return a
 }
 
+// resetAuthState clears the credential/TLS-identity and Unix socket fields
+// owned by a single NewClient* call, so building a client for one host can't
+// leak its OAuth token, client certificate or socket path into a client
+// subsequently built for another host on the shared global a (e.g. glab
+// commands that touch a fork and its upstream in the same process).
+func resetAuthState() {
+	a.AuthType = NoToken
+	a.caFile = ""
+	a.certFile = ""
+	a.keyFile = ""
+	a.socketPath = ""
+	a.oauthToken = ""
+	a.refreshToken = ""
+	a.tokenExpiry = time.Time{}
+}
+
 // HTTPClient returns the httpClient instance used to initialise the gitlab api client
 func HTTPClient() *http.Client { return a.HTTPClient() }
 func (c *Client) HTTPClient() *http.Client {
@@ -103,30 +179,276 @@ func (c *Client) SetProtocol(protocol string) {
 	c.Protocol = protocol
 }
 
+// SetAuthType sets the token type c authenticates with. The NewClient*
+// constructors reset it: NewClientWithOAuth sets OAuthToken, and the others
+// start from NoToken, after which NewLab sets PrivateToken whenever a token
+// is present. A type set before calling one of them is therefore not kept.
+// Only NoToken, OAuthToken and PrivateToken exist; there is no job token type.
+func SetAuthType(t authType) { a.SetAuthType(t) }
+func (c *Client) SetAuthType(t authType) {
+	c.AuthType = t
+}
+
+// WithTransportMiddleware registers an additional transport middleware,
+// layered on top of the built-in correlation-ID, logging, and debug-dump
+// ones in the order registered. Call before NewClient/NewClientWithCfg so it
+// takes effect on the client built for c.
+func (c *Client) WithTransportMiddleware(mw func(http.RoundTripper) http.RoundTripper) *Client {
+	c.transportMiddleware = append(c.transportMiddleware, mw)
+	return c
+}
+
+// correlationIDTransport stamps every outgoing request with a fresh
+// correlation ID, propagated as both X-Request-ID and Correlation-ID so it
+// shows up in GitLab's own request logs (see labkit's correlation package).
+type correlationIDTransport struct{ rt http.RoundTripper }
+
+func (t *correlationIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	id := newCorrelationID()
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Request-ID", id)
+	req.Header.Set("Correlation-ID", id)
+	return t.rt.RoundTrip(req)
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// CorrelationIDMiddleware injects a per-request correlation ID header.
+func CorrelationIDMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return &correlationIDTransport{rt: rt}
+}
+
+// loggingTransport logs method, URL, status, duration, and response size
+// for every request, but only when GLAB_DEBUG is set.
+type loggingTransport struct{ rt http.RoundTripper }
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if os.Getenv(apiDebugEnvVar) == "" {
+		return t.rt.RoundTrip(req)
+	}
+
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		log.Printf("[api] %s %s failed after %s: %v", req.Method, req.URL, time.Since(start), err)
+		return resp, err
+	}
+	log.Printf("[api] %s %s -> %d (%d bytes) in %s", req.Method, req.URL, resp.StatusCode, resp.ContentLength, time.Since(start))
+	return resp, nil
+}
+
+// LoggingMiddleware logs method, URL, status, duration, and response size
+// when GLAB_DEBUG is set.
+func LoggingMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return &loggingTransport{rt: rt}
+}
+
+// debugDumpTransport dumps full request/response bodies to stderr when
+// GLAB_DEBUG=api, for diagnosing glab commands failing against custom
+// GitLab installs.
+type debugDumpTransport struct{ rt http.RoundTripper }
+
+func (t *debugDumpTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if os.Getenv(apiDebugEnvVar) != "api" {
+		return t.rt.RoundTrip(req)
+	}
+
+	if dump, err := httputil.DumpRequestOut(req, true); err == nil {
+		fmt.Fprintf(os.Stderr, "--- api request ---\n%s\n", dump)
+	}
+
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	if dump, err := httputil.DumpResponse(resp, true); err == nil {
+		fmt.Fprintf(os.Stderr, "--- api response ---\n%s\n", dump)
+	}
+	return resp, nil
+}
+
+// DebugDumpMiddleware dumps full request/response bodies to stderr when
+// GLAB_DEBUG=api.
+func DebugDumpMiddleware(rt http.RoundTripper) http.RoundTripper {
+	return &debugDumpTransport{rt: rt}
+}
+
+// defaultTransportMiddleware are applied to every Client, ahead of any
+// registered via WithTransportMiddleware. Order matters: each entry wraps
+// the ones before it, so the last entry runs first on the way out and last
+// on the way back in. CorrelationIDMiddleware is listed last so its
+// X-Request-ID/Correlation-ID headers are already on the request by the
+// time DebugDumpMiddleware dumps it, letting the two be cross-referenced.
+var defaultTransportMiddleware = []func(http.RoundTripper) http.RoundTripper{
+	DebugDumpMiddleware,
+	LoggingMiddleware,
+	CorrelationIDMiddleware,
+}
+
+// applyTransportMiddleware layers the default and user-registered transport
+// middleware onto httpClient's transport.
+func (c *Client) applyTransportMiddleware(httpClient *http.Client) *http.Client {
+	rt := httpClient.Transport
+	if rt == nil {
+		rt = http.DefaultTransport
+	}
+	for _, mw := range defaultTransportMiddleware {
+		rt = mw(rt)
+	}
+	for _, mw := range c.transportMiddleware {
+		rt = mw(rt)
+	}
+	wrapped := *httpClient
+	wrapped.Transport = rt
+	return &wrapped
+}
+
+// WithHTTPRetryOpts configures the retry behaviour go-gitlab applies to its
+// own internal retryablehttp client for transient failures (5xx responses,
+// 429s honoring Retry-After, and network errors) on every request made
+// through c. POST requests are only retried when allowPostRetry is true,
+// since retrying a POST whose response was lost in transit can duplicate
+// whatever side effect it had. Call before NewClient so it takes effect on
+// the client built for c. NewClientWithCfg sets these itself from the
+// retry_* config keys (or the defaults when they are unset), replacing
+// anything set here beforehand.
+func (c *Client) WithHTTPRetryOpts(waitMin, waitMax time.Duration, maxAttempts int, allowPostRetry bool) *Client {
+	c.retryWaitMin = waitMin
+	c.retryWaitMax = waitMax
+	c.retryMax = maxAttempts
+	c.retryAllowPost = allowPostRetry
+	return c
+}
+
+// retryOpts returns the gitlab.ClientOptionFuncs that configure go-gitlab's
+// built-in retry behaviour per c's retry settings, rather than layering a
+// second, independent retry loop on top of it. Retries are gated by method:
+// idempotent methods follow the usual retry policy, but POST is only
+// retried when c.retryAllowPost is set, since a lost response to a POST
+// that actually succeeded server-side would otherwise be retried into a
+// duplicate.
+func (c *Client) retryOpts() []gitlab.ClientOptionFunc {
+	if c.retryMax <= 0 {
+		return []gitlab.ClientOptionFunc{gitlab.WithoutRetries()}
+	}
+	allowPost := c.retryAllowPost
+	checkRetry := func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		if resp != nil && resp.Request != nil && resp.Request.Method == http.MethodPost && !allowPost {
+			return false, nil
+		}
+		return retryablehttp.DefaultRetryPolicy(ctx, resp, err)
+	}
+	return []gitlab.ClientOptionFunc{
+		gitlab.WithCustomRetry(checkRetry),
+		gitlab.WithCustomRetryMax(c.retryMax),
+		gitlab.WithCustomRetryWaitMinMax(c.retryWaitMin, c.retryWaitMax),
+	}
+}
+
+// httpClientCfg describes the TLS-relevant knobs shared by the various
+// NewClientWith* constructors, so the transport is only assembled in one
+// place.
+type httpClientCfg struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	skipVerify bool
+}
+
+// buildTransport assembles an *http.Transport from an httpClientCfg,
+// loading the CA bundle and/or client certificate pair when given.
+func buildTransport(cfg httpClientCfg) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.skipVerify,
+	}
+
+	if cfg.caFile != "" {
+		caCert, err := ioutil.ReadFile(cfg.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading cert file: %w", err)
+		}
+		// use system cert pool as a baseline
+		caCertPool, err := x509.SystemCertPool()
+		if err != nil {
+			return nil, err
+		}
+		caCertPool.AppendCertsFromPEM(caCert)
+		tlsConfig.RootCAs = caCertPool
+	}
+
+	if cfg.certFile != "" || cfg.keyFile != "" {
+		if cfg.certFile == "" || cfg.keyFile == "" {
+			return nil, fmt.Errorf("both client_cert and client_key must be set")
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		TLSClientConfig:       tlsConfig,
+	}, nil
+}
+
+// unixSocketHost splits a "unix:"-prefixed host into its socket path, for
+// use with NewClient and NewClientWithCfg.
+func unixSocketHost(host string) (string, bool) {
+	if !strings.HasPrefix(host, unixSocketPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(host, unixSocketPrefix), true
+}
+
+// buildSocketTransport returns a transport that dials socketPath for every
+// connection, regardless of the URL host the request is addressed to.
+func buildSocketTransport(socketPath string) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
+		},
+	}
+}
+
 // NewClient initializes a api client for use throughout glab.
 func NewClient(host, token string, allowInsecure bool, isGraphQL bool) (*Client, error) {
+	resetAuthState()
 	a.host = host
 	a.token = token
 	a.allowInsecure = allowInsecure
 	a.isGraphQL = isGraphQL
 
-	if a.httpClientOverride != nil {
-		a.httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				ForceAttemptHTTP2:     true,
-				MaxIdleConns:          100,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: a.allowInsecure,
-				},
-			},
+	if socketPath, ok := unixSocketHost(host); ok {
+		a.socketPath = socketPath
+		a.httpClient = &http.Client{Transport: buildSocketTransport(socketPath)}
+	} else {
+		a.socketPath = ""
+		if a.httpClientOverride != nil {
+			transport, err := buildTransport(httpClientCfg{skipVerify: a.allowInsecure})
+			if err != nil {
+				return nil, err
+			}
+			a.httpClient = &http.Client{Transport: transport}
 		}
 	}
 	a.refreshLabInstance = true
@@ -136,43 +458,155 @@ func NewClient(host, token string, allowInsecure bool, isGraphQL bool) (*Client,
 
 // NewClientWithCustomCA initializes the global api client with a self-signed certificate
 func NewClientWithCustomCA(host, token, caFile string, isGraphQL bool) (*Client, error) {
+	resetAuthState()
 	a.host = host
 	a.token = token
 	a.caFile = caFile
 	a.isGraphQL = isGraphQL
 
-	if a.httpClientOverride != nil {
-		caCert, err := ioutil.ReadFile(a.caFile)
-		if err != nil {
-			return nil, fmt.Errorf("error reading cert file: %w", err)
+	transport, err := buildTransport(httpClientCfg{caFile: a.caFile})
+	if err != nil {
+		return nil, err
+	}
+	a.httpClient = &http.Client{Transport: transport}
+
+	a.refreshLabInstance = true
+	err = a.NewLab()
+	return a, err
+}
+
+// NewClientWithClientCert initializes the global api client with a client
+// certificate/key pair for mutual TLS, in addition to the usual CA handling
+// done by NewClientWithCustomCA.
+func NewClientWithClientCert(host, token, certPath, keyPath, caFile string, skipVerify bool, isGraphQL bool) (*Client, error) {
+	resetAuthState()
+	a.host = host
+	a.token = token
+	a.caFile = caFile
+	a.certFile = certPath
+	a.keyFile = keyPath
+	a.allowInsecure = skipVerify
+	a.isGraphQL = isGraphQL
+
+	transport, err := buildTransport(httpClientCfg{
+		certFile:   a.certFile,
+		keyFile:    a.keyFile,
+		caFile:     a.caFile,
+		skipVerify: a.allowInsecure,
+	})
+	if err != nil {
+		return nil, err
+	}
+	a.httpClient = &http.Client{Transport: transport}
+
+	a.refreshLabInstance = true
+	err = a.NewLab()
+	return a, err
+}
+
+// oauthRefreshTransport wraps an underlying transport, refreshing c's OAuth2
+// token (and persisting the result back through cfg) whenever it's near
+// expiry or the server comes back with a 401.
+type oauthRefreshTransport struct {
+	rt   http.RoundTripper
+	c    *Client
+	cfg  config.Config
+	host string
+}
+
+func (t *oauthRefreshTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.c.oauthTokenExpiringSoon() {
+		if err := t.c.refreshOAuthToken(t.cfg, t.host); err != nil {
+			return nil, fmt.Errorf("refreshing oauth token: %w", err)
 		}
-		// use system cert pool as a baseline
-		caCertPool, err := x509.SystemCertPool()
+	}
+
+	// go-gitlab sets the Authorization header from the token it was built
+	// with; send c's current, possibly refreshed, token instead.
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.c.oauthToken)
+
+	resp, err := t.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if err := t.c.refreshOAuthToken(t.cfg, t.host); err != nil {
+		return resp, nil
+	}
+
+	retryReq := req.Clone(req.Context())
+	retryReq.Header.Set("Authorization", "Bearer "+t.c.oauthToken)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
 		if err != nil {
-			return nil, err
+			return resp, nil
 		}
-		caCertPool.AppendCertsFromPEM(caCert)
+		retryReq.Body = body
+	}
+	return t.rt.RoundTrip(retryReq)
+}
 
-		a.httpClient = &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				DialContext: (&net.Dialer{
-					Timeout:   30 * time.Second,
-					KeepAlive: 30 * time.Second,
-				}).DialContext,
-				ForceAttemptHTTP2:     true,
-				MaxIdleConns:          100,
-				IdleConnTimeout:       90 * time.Second,
-				TLSHandshakeTimeout:   10 * time.Second,
-				ExpectContinueTimeout: 1 * time.Second,
-				TLSClientConfig: &tls.Config{
-					RootCAs: caCertPool,
-				},
-			},
-		}
+func (c *Client) oauthTokenExpiringSoon() bool {
+	if c.tokenExpiry.IsZero() {
+		return false
+	}
+	return time.Until(c.tokenExpiry) < oauthRefreshSkew
+}
+
+// refreshOAuthToken exchanges c.refreshToken for a new access token against
+// host's /oauth/token endpoint and persists the result through cfg, so the
+// next glab invocation picks up the refreshed token instead of refreshing
+// again.
+func (c *Client) refreshOAuthToken(cfg config.Config, host string) error {
+	if c.refreshToken == "" {
+		return fmt.Errorf("no refresh token available to renew the OAuth2 session")
+	}
+
+	oauthCfg := &oauth2.Config{
+		Endpoint: oauth2.Endpoint{TokenURL: fmt.Sprintf("%s://%s/oauth/token", c.Protocol, host)},
+	}
+	newToken, err := oauthCfg.TokenSource(context.Background(), &oauth2.Token{RefreshToken: c.refreshToken}).Token()
+	if err != nil {
+		return err
+	}
+
+	c.oauthToken = newToken.AccessToken
+	c.token = newToken.AccessToken
+	if newToken.RefreshToken != "" {
+		c.refreshToken = newToken.RefreshToken
+	}
+	c.tokenExpiry = newToken.Expiry
+
+	if cfg != nil {
+		_ = cfg.Set(host, "oauth_token", c.oauthToken)
+		_ = cfg.Set(host, "refresh_token", c.refreshToken)
+		_ = cfg.Set(host, "token_expiry", c.tokenExpiry.Format(time.RFC3339))
+	}
+	return nil
+}
+
+// NewClientWithOAuth initializes the global api client with an OAuth2 access
+// token, refreshing it against host's /oauth/token endpoint (and persisting
+// the refreshed tokens through cfg) when it's expired or near expiry.
+func NewClientWithOAuth(host, oauthToken, refreshToken string, tokenExpiry time.Time, cfg config.Config, isGraphQL bool) (*Client, error) {
+	resetAuthState()
+	a.host = host
+	a.token = oauthToken
+	a.oauthToken = oauthToken
+	a.refreshToken = refreshToken
+	a.tokenExpiry = tokenExpiry
+	a.isGraphQL = isGraphQL
+	a.AuthType = OAuthToken
+
+	transport, err := buildTransport(httpClientCfg{})
+	if err != nil {
+		return nil, err
 	}
+	a.httpClient = &http.Client{Transport: &oauthRefreshTransport{rt: transport, c: a, cfg: cfg, host: host}}
+
 	a.refreshLabInstance = true
-	err := a.NewLab()
+	err = a.NewLab()
 	return a, err
 }
 
@@ -185,9 +619,52 @@ func NewClientWithCfg(repoHost string, cfg config.Config, isGraphQL bool) (clien
 	tlsVerify, _ := cfg.Get(repoHost, "skip_tls_verify")
 	skipTlsVerify := tlsVerify == "true" || tlsVerify == "1"
 	caCert, _ := cfg.Get(repoHost, "ca_cert")
-	if caCert != "" {
+	clientCert, _ := cfg.Get(repoHost, "client_cert")
+	clientKey, _ := cfg.Get(repoHost, "client_key")
+	socketPath, _ := cfg.Get(repoHost, "socket_path")
+	oauthToken, _ := cfg.Get(repoHost, "oauth_token")
+	refreshToken, _ := cfg.Get(repoHost, "refresh_token")
+	var tokenExpiry time.Time
+	if v, _ := cfg.Get(repoHost, "token_expiry"); v != "" {
+		if ts, err := time.Parse(time.RFC3339, v); err == nil {
+			tokenExpiry = ts
+		}
+	}
+
+	retryMax := defaultRetryMax
+	if v, _ := cfg.Get(repoHost, "retry_max"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			retryMax = n
+		}
+	}
+	retryWaitMin := defaultRetryWaitMin
+	if v, _ := cfg.Get(repoHost, "retry_wait_min"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			retryWaitMin = d
+		}
+	}
+	retryWaitMax := defaultRetryWaitMax
+	if v, _ := cfg.Get(repoHost, "retry_wait_max"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil {
+			retryWaitMax = d
+		}
+	}
+	retryAllowPostCfg, _ := cfg.Get(repoHost, "retry_allow_post")
+	retryAllowPost := retryAllowPostCfg == "true" || retryAllowPostCfg == "1"
+	a.WithHTTPRetryOpts(retryWaitMin, retryWaitMax, retryMax, retryAllowPost)
+
+	switch {
+	case socketPath != "":
+		client, err = NewClient(unixSocketPrefix+socketPath, token, skipTlsVerify, isGraphQL)
+	case strings.HasPrefix(repoHost, unixSocketPrefix):
+		client, err = NewClient(repoHost, token, skipTlsVerify, isGraphQL)
+	case oauthToken != "":
+		client, err = NewClientWithOAuth(repoHost, oauthToken, refreshToken, tokenExpiry, cfg, isGraphQL)
+	case clientCert != "" && clientKey != "":
+		client, err = NewClientWithClientCert(repoHost, token, clientCert, clientKey, caCert, skipTlsVerify, isGraphQL)
+	case caCert != "":
 		client, err = NewClientWithCustomCA(repoHost, token, caCert, isGraphQL)
-	} else {
+	default:
 		client, err = NewClient(repoHost, token, skipTlsVerify, isGraphQL)
 	}
 	if err != nil {
@@ -206,22 +683,40 @@ func (c *Client) NewLab() error {
 		httpClient = c.httpClientOverride
 	}
 	if a.refreshLabInstance {
-		if c.host == "" {
-			c.host = glinstance.OverridableDefault()
+		if c.socketPath != "" {
+			// Requests are always dialed to c.socketPath by the transport
+			// set up in NewClient, so the host/protocol in the URL are
+			// irrelevant beyond matching what the GitLab Rails app expects.
+			if c.isGraphQL {
+				baseURL = unixSocketBaseURL + "/api/graphql"
+			} else {
+				baseURL = unixSocketBaseURL + "/api/v4"
+			}
+		} else {
+			if c.host == "" {
+				c.host = glinstance.OverridableDefault()
+			}
+			if c.isGraphQL {
+				baseURL = glinstance.GraphQLEndpoint(c.host, c.Protocol)
+			} else {
+				baseURL = glinstance.APIEndpoint(c.host, c.Protocol)
+			}
 		}
-		if c.isGraphQL {
-			baseURL = glinstance.GraphQLEndpoint(c.host, c.Protocol)
+		httpClient = c.applyTransportMiddleware(httpClient)
+
+		labOpts := append([]gitlab.ClientOptionFunc{gitlab.WithHTTPClient(httpClient), gitlab.WithBaseURL(baseURL)}, c.retryOpts()...)
+		if c.AuthType == OAuthToken {
+			c.LabClient, err = gitlab.NewOAuthClient(c.oauthToken, labOpts...)
 		} else {
-			baseURL = glinstance.APIEndpoint(c.host, c.Protocol)
+			c.LabClient, err = gitlab.NewClient(c.token, labOpts...)
 		}
-		c.LabClient, err = gitlab.NewClient(c.token, gitlab.WithHTTPClient(httpClient), gitlab.WithBaseURL(baseURL))
 		if err != nil {
 			return fmt.Errorf("failed to initialize GitLab client: %v", err)
 		}
 		c.LabClient.UserAgent = UserAgent
 
 		apiClient = c.LabClient
-		if c.token != "" {
+		if c.token != "" && c.AuthType == NoToken {
 			c.AuthType = PrivateToken
 		}
 	}